@@ -0,0 +1,167 @@
+// Package acl wraps libacl to grant and revoke POSIX access ACL entries, used to share XDG
+// runtime directories and sockets between the session user and the user that started emptty
+// without resorting to group membership or world-writable permissions.
+package acl
+
+/*
+#cgo LDFLAGS: -lacl
+#include <stdlib.h>
+#include <sys/types.h>
+#include <sys/acl.h>
+#include <acl/libacl.h>
+
+static int acl_grant_user(const char *path, uid_t uid, int read, int write, int execute) {
+	acl_t acl = acl_get_file(path, ACL_TYPE_ACCESS);
+	if (acl == NULL) {
+		acl = acl_init(1);
+	}
+
+	// Look for an existing ACL_USER entry for uid first -- acl_valid() rejects an ACL with two
+	// entries for the same qualifier, so a second grant() for the same (path, uid) must update
+	// the entry already there instead of creating another one.
+	acl_entry_t entry;
+	int found = 0;
+	for (int res = acl_get_entry(acl, ACL_FIRST_ENTRY, &entry); res == 1; res = acl_get_entry(acl, ACL_NEXT_ENTRY, &entry)) {
+		acl_tag_t tag;
+		acl_get_tag_type(entry, &tag);
+		if (tag != ACL_USER) {
+			continue;
+		}
+		uid_t *qualifier = (uid_t *)acl_get_qualifier(entry);
+		if (qualifier != NULL && *qualifier == uid) {
+			acl_free(qualifier);
+			found = 1;
+			break;
+		}
+		if (qualifier != NULL) {
+			acl_free(qualifier);
+		}
+	}
+
+	if (!found) {
+		if (acl_create_entry(&acl, &entry) != 0) {
+			acl_free(acl);
+			return -1;
+		}
+		acl_set_tag_type(entry, ACL_USER);
+		acl_set_qualifier(entry, &uid);
+	}
+
+	acl_permset_t permset;
+	acl_get_permset(entry, &permset);
+	acl_clear_perms(permset);
+	if (read) acl_add_perm(permset, ACL_READ);
+	if (write) acl_add_perm(permset, ACL_WRITE);
+	if (execute) acl_add_perm(permset, ACL_EXECUTE);
+	acl_set_permset(entry, permset);
+
+	int ret = acl_calc_mask(&acl) == 0 && acl_valid(acl) == 0 ? acl_set_file(path, ACL_TYPE_ACCESS, acl) : -1;
+	acl_free(acl);
+	return ret;
+}
+
+static int acl_revoke_user(const char *path, uid_t uid) {
+	acl_t acl = acl_get_file(path, ACL_TYPE_ACCESS);
+	if (acl == NULL) {
+		return -1;
+	}
+
+	acl_entry_t entry;
+	int ret = 0;
+	int found = -1;
+	for (int res = acl_get_entry(acl, ACL_FIRST_ENTRY, &entry); res == 1; res = acl_get_entry(acl, ACL_NEXT_ENTRY, &entry)) {
+		acl_tag_t tag;
+		acl_get_tag_type(entry, &tag);
+		if (tag != ACL_USER) {
+			continue;
+		}
+		uid_t *qualifier = (uid_t *)acl_get_qualifier(entry);
+		if (qualifier != NULL && *qualifier == uid) {
+			acl_free(qualifier);
+			found = acl_delete_entry(acl, entry);
+			break;
+		}
+		if (qualifier != NULL) {
+			acl_free(qualifier);
+		}
+	}
+
+	if (found == 0) {
+		ret = acl_set_file(path, ACL_TYPE_ACCESS, acl);
+	}
+	acl_free(acl);
+	return found == 0 ? ret : -1;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Perm is a POSIX ACL permission set, e.g. "r-x" or "rwx".
+type Perm struct {
+	Read, Write, Execute bool
+}
+
+// ParsePerm converts a "rwx"-style string (missing letters or "-" mean denied) into a Perm.
+func ParsePerm(s string) Perm {
+	return Perm{
+		Read:    strContains(s, 'r'),
+		Write:   strContains(s, 'w'),
+		Execute: strContains(s, 'x'),
+	}
+}
+
+func strContains(s string, b byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Grant adds (or replaces) a named-user ACL_TYPE_ACCESS entry on path, giving uid the given perm.
+func Grant(path string, uid int, perm Perm) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	if C.acl_grant_user(cPath, C.uid_t(uid), boolToInt(perm.Read), boolToInt(perm.Write), boolToInt(perm.Execute)) != 0 {
+		return fmt.Errorf("acl: failed to grant %s to uid %d on %s", permString(perm), uid, path)
+	}
+	return nil
+}
+
+// Revoke removes the named-user ACL_TYPE_ACCESS entry for uid from path, undoing a prior Grant.
+func Revoke(path string, uid int) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	if C.acl_revoke_user(cPath, C.uid_t(uid)) != 0 {
+		return fmt.Errorf("acl: failed to revoke uid %d from %s", uid, path)
+	}
+	return nil
+}
+
+func boolToInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func permString(p Perm) string {
+	out := []byte("---")
+	if p.Read {
+		out[0] = 'r'
+	}
+	if p.Write {
+		out[1] = 'w'
+	}
+	if p.Execute {
+		out[2] = 'x'
+	}
+	return string(out)
+}
@@ -0,0 +1,113 @@
+package src
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/kianmeng/emptty/src/acl"
+)
+
+const stateDir = "/run/emptty/state"
+
+// aclGrant records one ACL mutation performed on behalf of a session, so it can be undone again.
+type aclGrant struct {
+	Path string `json:"path"`
+	Uid  int    `json:"uid"`
+}
+
+// aclRevertStack tracks every ACL grant made for a running session and persists it to
+// /run/emptty/state/<pid>.json as it grows, so a crashed emptty leaves behind enough information for
+// `emptty --reset` to undo it later.
+type aclRevertStack struct {
+	pid       int
+	grants    []aclGrant
+	drainOnce sync.Once
+}
+
+// newAclRevertStack creates a revert stack for the emptty process identified by pid.
+func newAclRevertStack(pid int) *aclRevertStack {
+	return &aclRevertStack{pid: pid}
+}
+
+// grant applies perm for uid on path and pushes it onto the revert stack.
+func (s *aclRevertStack) grant(path string, uid int, perm acl.Perm) error {
+	if err := acl.Grant(path, uid, perm); err != nil {
+		return err
+	}
+
+	s.grants = append(s.grants, aclGrant{Path: path, Uid: uid})
+	return s.persist()
+}
+
+// persist writes the current revert stack to its state file under stateDir.
+func (s *aclRevertStack) persist() error {
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(s.grants)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.statePath(), b, 0600)
+}
+
+func (s *aclRevertStack) statePath() string {
+	return filepath.Join(stateDir, strconv.Itoa(s.pid)+".json")
+}
+
+// drain reverts every grant on the stack, in reverse order, and removes the state file. Both the
+// normal completion path and the interrupt handler call drain() on the same stack, so the actual
+// work runs at most once no matter which of them gets there first.
+func (s *aclRevertStack) drain() {
+	if s == nil {
+		return
+	}
+
+	s.drainOnce.Do(func() {
+		for i := len(s.grants) - 1; i >= 0; i-- {
+			g := s.grants[i]
+			if err := acl.Revoke(g.Path, g.Uid); err != nil {
+				logPrint(err)
+			}
+		}
+
+		os.Remove(s.statePath())
+		s.grants = nil
+	})
+}
+
+// Reset walks pending ACL state files left behind by a crashed emptty and reverts their grants.
+// It backs the `emptty --reset` subcommand.
+func Reset() {
+	entries, err := os.ReadDir(stateDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(stateDir, entry.Name())
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var grants []aclGrant
+		if err := json.Unmarshal(b, &grants); err != nil {
+			continue
+		}
+
+		for _, g := range grants {
+			if err := acl.Revoke(g.Path, g.Uid); err != nil {
+				logPrint(err)
+			}
+		}
+
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,138 @@
+package src
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const pathConfig = "/etc/emptty/conf"
+
+// config holds every setting emptty was started with, parsed from pathConfig, falling back to its
+// defaults for anything the file leaves unset.
+type config struct {
+	Tty           int
+	SwitchTTY     bool
+	EnableNumlock bool
+	PrintIssue    bool
+	FgColor       string
+	BgColor       string
+	Lang          string
+	NoXdgFallback bool
+
+	AlwaysDbusLaunch bool
+	DbusLaunch       bool
+	XinitrcLaunch    bool
+
+	// D-Bus proxy policy (request chunk0-1)
+	EnableDbusProxy   bool
+	DbusSessionPolicy string
+	DbusSystemPolicy  string
+
+	// Session launcher backend (request chunk0-2), one of "direct" (default), "sudo" or
+	// "machinectl".
+	Launcher string
+
+	// Sockets inherited from the user that started emptty, shared via ACL (request chunk0-3).
+	InheritWaylandSocket bool
+	WaylandDisplaySocket string
+	InheritPulseSocket   bool
+	PulseSocket          string
+
+	// Comma-separated extra local usernames granted X host access (request chunk0-5).
+	XhostUsers string
+}
+
+// loadConfig reads pathConfig into a config, applying defaults for anything left unset.
+func loadConfig() *config {
+	conf := &config{
+		Tty:     1,
+		FgColor: "7",
+		BgColor: "0",
+		Lang:    "en_US.UTF-8",
+	}
+
+	f, err := os.Open(pathConfig)
+	if err != nil {
+		return conf
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		applyConfigLine(conf, scanner.Text())
+	}
+
+	return conf
+}
+
+// applyConfigLine parses a single KEY=VALUE line from the config file, ignoring comments, blank
+// lines and unknown keys.
+func applyConfigLine(conf *config, line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	kv := strings.SplitN(line, "=", 2)
+	if len(kv) != 2 {
+		return
+	}
+	key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+	switch key {
+	case "TTY_NUMBER":
+		if n, err := strconv.Atoi(value); err == nil {
+			conf.Tty = n
+		}
+	case "SWITCH_TTY":
+		conf.SwitchTTY = value == "true"
+	case "NUMLOCK_ON":
+		conf.EnableNumlock = value == "true"
+	case "PRINT_ISSUE":
+		conf.PrintIssue = value == "true"
+	case "FG_COLOR":
+		conf.FgColor = value
+	case "BG_COLOR":
+		conf.BgColor = value
+	case "LANG":
+		conf.Lang = value
+	case "NO_XDG_FALLBACK":
+		conf.NoXdgFallback = value == "true"
+	case "DBUS_LAUNCH":
+		conf.DbusLaunch = value == "true"
+	case "ALWAYS_DBUS_LAUNCH":
+		conf.AlwaysDbusLaunch = value == "true"
+	case "XINITRC_LAUNCH":
+		conf.XinitrcLaunch = value == "true"
+	case "ENABLE_DBUS_PROXY":
+		conf.EnableDbusProxy = value == "true"
+	case "DBUS_SESSION_POLICY":
+		conf.DbusSessionPolicy = value
+	case "DBUS_SYSTEM_POLICY":
+		conf.DbusSystemPolicy = value
+	case "LAUNCHER":
+		conf.Launcher = value
+	case "INHERIT_WAYLAND_SOCKET":
+		conf.InheritWaylandSocket = value == "true"
+	case "WAYLAND_DISPLAY_SOCKET":
+		conf.WaylandDisplaySocket = value
+	case "INHERIT_PULSE_SOCKET":
+		conf.InheritPulseSocket = value == "true"
+	case "PULSE_SOCKET":
+		conf.PulseSocket = value
+	case "XHOST_USERS":
+		conf.XhostUsers = value
+	}
+}
+
+// Returns the configured TTY as a decimal string, e.g. for chvt or utmp.
+func (c *config) strTTY() string {
+	return strconv.Itoa(c.Tty)
+}
+
+// Returns the device path of the configured TTY.
+func (c *config) ttyPath() string {
+	return "/dev/tty" + c.strTTY()
+}
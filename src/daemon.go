@@ -1,24 +1,28 @@
 package src
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
 	strCleanScreen = "\x1b[H\x1b[2J"
 	pathIssue      = "/etc/issue"
+	pathUtmp       = "/var/run/utmp"
 )
 
 // IssueVariable defines list of all escape sequences found in issue file
 type issueVariable struct {
-	issue string
-	char  byte
-	arg   string
+	issue   string
+	char    byte
+	arg     string
+	offsets []int
 }
 
 // Starts emptty as daemon spawning emptty on defined TTY.
@@ -97,15 +101,17 @@ func printIssue(path, strTTY string) {
 	}
 }
 
-// Finds all unique issue escape sequences
+// Finds all unique issue escape sequences, recording every offset at which each one occurs so
+// evaluateIssueVars can replace them by position instead of by (possibly overlapping) substring.
 func findUniqueIssueVars(issue string) []*issueVariable {
 	var result []*issueVariable
-	var knownIssues []string
+	knownIssues := make(map[string]*issueVariable)
 
 	saveData := false
 	var buffer strings.Builder
 	var varName byte
 	var arg strings.Builder
+	tokenStart := 0
 
 	for i := 0; i < len(issue); i++ {
 		b := issue[i]
@@ -114,6 +120,7 @@ func findUniqueIssueVars(issue string) []*issueVariable {
 			saveData = true
 			buffer.Reset()
 			arg.Reset()
+			tokenStart = i
 		}
 
 		if saveData {
@@ -126,9 +133,13 @@ func findUniqueIssueVars(issue string) []*issueVariable {
 			}
 			buffer.WriteByte(b)
 			if i == (len(issue)-1) || (i < len(issue) && i > 0 && issue[i-1] == '\\' && issue[i+1] != '{') || b == '}' {
-				if !contains(knownIssues, buffer.String()) {
-					result = append(result, &issueVariable{buffer.String(), varName, arg.String()})
-					knownIssues = append(knownIssues, buffer.String())
+				token := buffer.String()
+				if existing, found := knownIssues[token]; found {
+					existing.offsets = append(existing.offsets, tokenStart)
+				} else {
+					issueVar := &issueVariable{token, varName, arg.String(), []int{tokenStart}}
+					result = append(result, issueVar)
+					knownIssues[token] = issueVar
 				}
 
 				saveData = false
@@ -139,47 +150,122 @@ func findUniqueIssueVars(issue string) []*issueVariable {
 	return result
 }
 
-// Evaluates outputs for all known escape sequences and return replaced issue
+// issueReplacement is one resolved occurrence of an escape sequence, located by its byte range in
+// the original issue string.
+type issueReplacement struct {
+	start, end int
+	output     string
+}
+
+// Evaluates outputs for all known escape sequences and returns the issue with every occurrence
+// replaced. Replacement is done with a single left-to-right scan over the recorded token offsets,
+// rather than repeated strings.ReplaceAll on the full string, so that one escape sequence's output
+// can never corrupt a match still pending for another (e.g. `\S` output containing `\4`).
 func evaluateIssueVars(issue string, issueVars []*issueVariable, strTTY string) string {
-	result := issue
+	var replacements []issueReplacement
+
+	for _, issueVar := range issueVars {
+		output, processed := evaluateIssueVar(issueVar, strTTY)
+		if !processed {
+			continue
+		}
+
+		for _, start := range issueVar.offsets {
+			replacements = append(replacements, issueReplacement{start, start + len(issueVar.issue), output})
+		}
+	}
 
-	sort.Slice(issueVars, func(i int, j int) bool {
-		return len(issueVars[i].arg) > len(issueVars[j].arg)
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].start < replacements[j].start
 	})
 
-	for _, issueVar := range issueVars {
-		output := ""
-		processed := true
-
-		switch issueVar.char {
-		case 'd':
-			output = runSimpleCmd("date")
-		case 'l':
-			output = getCurrentTTYName(strTTY, false)
-		case 'm':
-			output = runSimpleCmd("uname", "-m")
-		case 'n':
-			output = runSimpleCmd("uname", "-n")
-		case 'O':
-			output = getDnsDomainName()
-		case 'r':
-			output = runSimpleCmd("uname", "-r")
-		case 's':
-			output = runSimpleCmd("uname", "-s")
-		case 'S':
-			output = getOsReleaseValue(issueVar.arg)
-		case 't':
-			output = runSimpleCmd("date", "+%T")
-		case '4', '6':
-			output = getIpAddress(issueVar.arg, issueVar.char)
-		default:
-			processed = false
+	var result strings.Builder
+	pos := 0
+	for _, r := range replacements {
+		if r.start < pos {
+			continue
 		}
+		result.WriteString(issue[pos:r.start])
+		result.WriteString(r.output)
+		pos = r.end
+	}
+	result.WriteString(issue[pos:])
+
+	return result.String()
+}
 
-		if processed {
-			result = strings.ReplaceAll(result, issueVar.issue, output)
+// Evaluates a single escape sequence, returning its output and whether it is a known sequence.
+func evaluateIssueVar(issueVar *issueVariable, strTTY string) (output string, processed bool) {
+	processed = true
+
+	switch issueVar.char {
+	case 'd':
+		output = runSimpleCmd("date")
+	case 'l':
+		output = getCurrentTTYName(strTTY, false)
+	case 'm':
+		output = runSimpleCmd("uname", "-m")
+	case 'n':
+		output = runSimpleCmd("uname", "-n")
+	case 'O':
+		output = getDnsDomainName()
+	case 'r':
+		output = runSimpleCmd("uname", "-r")
+	case 's':
+		output = runSimpleCmd("uname", "-s")
+	case 'S':
+		output = getOsReleaseValue(issueVar.arg)
+	case 't':
+		output = runSimpleCmd("date", "+%T")
+	case 'U':
+		output = strconv.Itoa(countLoggedInUsers())
+	case '4', '6':
+		output = getIpAddress(issueVar.arg, issueVar.char)
+	default:
+		processed = false
+	}
+
+	return output, processed
+}
+
+// utUserProcess is the ut_type value utmp uses for an entry that represents a logged-in user
+// session, as opposed to boot time, run level or init process records.
+const utUserProcess = 7
+
+// utmpRecord mirrors glibc's struct utmp (utmp.h) on Linux/amd64, which is what /var/run/utmp is
+// made of -- the same layout addUtmpEntry/endUtmpEntry write when they add and remove sessions.
+type utmpRecord struct {
+	Type    int16
+	_       [2]byte
+	Pid     int32
+	Line    [32]byte
+	Id      [4]byte
+	User    [32]byte
+	Host    [256]byte
+	Exit    [2]int16
+	Session int32
+	TvSec   int32
+	TvUsec  int32
+	AddrV6  [4]int32
+	_       [20]byte
+}
+
+// Counts currently logged-in users for the \U issue escape sequence, by reading ut_type ==
+// USER_PROCESS records straight out of the utmp database.
+func countLoggedInUsers() int {
+	f, err := os.Open(pathUtmp)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	count := 0
+	var rec utmpRecord
+	for binary.Read(f, binary.LittleEndian, &rec) == nil {
+		if rec.Type == utUserProcess {
+			count++
 		}
 	}
 
-	return result
+	return count
 }
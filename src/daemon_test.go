@@ -0,0 +1,110 @@
+package src
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindUniqueIssueVars(t *testing.T) {
+	tests := []struct {
+		name  string
+		issue string
+		want  []issueVariable
+	}{
+		{
+			name:  "bare and argumented variants are distinct",
+			issue: "Welcome \\S and \\S{VERSION_ID}\n",
+			want: []issueVariable{
+				{issue: "\\S", char: 'S', arg: "", offsets: []int{8}},
+				{issue: "\\S{VERSION_ID}", char: 'S', arg: "VERSION_ID", offsets: []int{15}},
+			},
+		},
+		{
+			name:  "repeated token records every offset",
+			issue: "\\4{eth0} then \\4{eth0} again",
+			want: []issueVariable{
+				{issue: "\\4{eth0}", char: '4', arg: "eth0", offsets: []int{0, 14}},
+			},
+		},
+		{
+			name:  "adjacent tokens do not bleed into each other",
+			issue: "\\n\\s",
+			want: []issueVariable{
+				{issue: "\\n", char: 'n', arg: "", offsets: []int{0}},
+				{issue: "\\s", char: 's', arg: "", offsets: []int{2}},
+			},
+		},
+		{
+			name:  "unterminated brace still closes at end of string",
+			issue: "\\S{PRETTY_NAME",
+			want: []issueVariable{
+				{issue: "\\S{PRETTY_NAME", char: 'S', arg: "PRETTY_NAME", offsets: []int{0}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findUniqueIssueVars(tt.issue)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("findUniqueIssueVars(%q) returned %d vars, want %d (%+v)", tt.issue, len(got), len(tt.want), got)
+			}
+
+			for i, want := range tt.want {
+				if got[i].issue != want.issue || got[i].char != want.char || got[i].arg != want.arg || !reflect.DeepEqual(got[i].offsets, want.offsets) {
+					t.Errorf("var %d = %+v, want %+v", i, *got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateIssueVarsLeavesUnknownSequencesInPlace(t *testing.T) {
+	issue := "before \\Z after"
+
+	got := evaluateIssueVars(issue, findUniqueIssueVars(issue), "tty1")
+
+	if got != issue {
+		t.Errorf("evaluateIssueVars(%q) = %q, want unchanged", issue, got)
+	}
+}
+
+func TestEvaluateIssueVarsReplacesEveryOccurrenceAtItsOwnOffset(t *testing.T) {
+	issue := "users=\\U and again \\U"
+
+	got := evaluateIssueVars(issue, findUniqueIssueVars(issue), "tty1")
+
+	want := "users=0 and again 0"
+	if got != want {
+		t.Errorf("evaluateIssueVars(%q) = %q, want %q", issue, got, want)
+	}
+}
+
+func TestParseOsReleaseFileFallsBackToArbitraryKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "os-release")
+	content := "PRETTY_NAME=\"Test OS 1\"\nVERSION_ID=1.0\n# comment\n\nBUILD_ID=abc123\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values := parseOsReleaseFile(path)
+
+	for key, want := range map[string]string{
+		"PRETTY_NAME": "Test OS 1",
+		"VERSION_ID":  "1.0",
+		"BUILD_ID":    "abc123",
+	} {
+		if values[key] != want {
+			t.Errorf("values[%q] = %q, want %q", key, values[key], want)
+		}
+	}
+}
+
+func TestCountLoggedInUsersDoesNotPanic(t *testing.T) {
+	if countLoggedInUsers() < 0 {
+		t.Error("countLoggedInUsers() returned a negative count")
+	}
+}
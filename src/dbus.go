@@ -0,0 +1,180 @@
+package src
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envDbusSessionBusAddress = "DBUS_SESSION_BUS_ADDRESS"
+	envDbusSystemBusAddress  = "DBUS_SYSTEM_BUS_ADDRESS"
+	binDbusLaunch            = "dbus-launch"
+	binDbusProxy             = "xdg-dbus-proxy"
+	pathSystemBusSocket      = "/var/run/dbus/system_bus_socket"
+	dbusProxyReadyTimeout    = 5 * time.Second
+)
+
+// dbus holds the handles of the filtered xdg-dbus-proxy instances emptty started to give the
+// session access to D-Bus. The bus daemon started by the plain `dbus-launch` fallback is not
+// tracked here; cmd is never set by launch().
+type dbus struct {
+	cmd          *exec.Cmd
+	sessionProxy *exec.Cmd
+	systemProxy  *exec.Cmd
+}
+
+// Launches D-Bus for the session. When proxying is enabled in config, untrusted sessions get a
+// filtered view of the session and system buses via xdg-dbus-proxy instead of direct access.
+// Returns an error to fail-close the session rather than starting it with an unfiltered bus.
+func (d *dbus) launch(usr *sysuser, conf *config) error {
+	if conf.EnableDbusProxy {
+		return d.launchProxy(usr, conf)
+	}
+
+	out := runSimpleCmd(binDbusLaunch, "--sh-syntax")
+	for _, line := range strings.Split(out, "\n") {
+		if addr := strings.TrimPrefix(line, "DBUS_SESSION_BUS_ADDRESS="); addr != line {
+			usr.setenv(envDbusSessionBusAddress, strings.Trim(strings.SplitN(addr, ";", 2)[0], "'"))
+		}
+	}
+
+	return nil
+}
+
+// Terminates both proxy instances started by launch(). The bus daemon left running by the
+// `dbus-launch` fallback is not terminated.
+func (d *dbus) interrupt() {
+	killIfRunning(d.sessionProxy)
+	killIfRunning(d.systemProxy)
+	killIfRunning(d.cmd)
+}
+
+// Starts xdg-dbus-proxy for the session and system buses, exposing the filtered sockets under
+// XDG_RUNTIME_DIR/emptty/bus and exporting their addresses into the user's environment.
+func (d *dbus) launchProxy(usr *sysuser, conf *config) error {
+	busDir := filepath.Join(usr.getenv(envXdgRuntimeDir), "emptty", "bus")
+	if err := os.MkdirAll(busDir, 0700); err != nil {
+		return err
+	}
+	os.Chown(busDir, usr.uid, usr.gid)
+
+	sessionSocket := filepath.Join(busDir, "session_bus_socket")
+	var err error
+	if d.sessionProxy, err = startDbusProxyInstance(os.Getenv(envDbusSessionBusAddress), sessionSocket, conf.DbusSessionPolicy); err != nil {
+		return err
+	}
+	usr.setenv(envDbusSessionBusAddress, "unix:path="+sessionSocket)
+
+	systemSocket := filepath.Join(busDir, "system_bus_socket")
+	if d.systemProxy, err = startDbusProxyInstance("unix:path="+pathSystemBusSocket, systemSocket, conf.DbusSystemPolicy); err != nil {
+		killIfRunning(d.sessionProxy)
+		return err
+	}
+	usr.setenv(envDbusSystemBusAddress, "unix:path="+systemSocket)
+
+	return nil
+}
+
+// Spawns a single xdg-dbus-proxy instance and blocks until it signals readiness on its --fd,
+// failing closed if the proxy process exits before doing so.
+func startDbusProxyInstance(busAddress, targetSocket, policy string) (*exec.Cmd, error) {
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyR.Close()
+
+	args := append([]string{busAddress, targetSocket, "--fd=3"}, parseDbusProxyPolicy(policy)...)
+	cmd := exec.Command(binDbusProxy, args...)
+	cmd.ExtraFiles = []*os.File{readyW}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	readyW.Close()
+
+	if !waitDbusProxyReady(cmd, readyR) {
+		killIfRunning(cmd)
+		return nil, errors.New(binDbusProxy + " exited before signalling readiness on " + targetSocket)
+	}
+
+	return cmd, nil
+}
+
+// Waits for the proxy to signal readiness on its --fd, or for the process to exit first,
+// whichever happens first. Returns true only if the proxy is still running once it has reported
+// readiness.
+func waitDbusProxyReady(cmd *exec.Cmd, readyR *os.File) bool {
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	ready := make(chan struct{})
+	go func() {
+		buf := make([]byte, 1)
+		readyR.Read(buf)
+		close(ready)
+	}()
+
+	select {
+	case <-ready:
+		return cmd.ProcessState == nil
+	case <-exited:
+		return false
+	case <-time.After(dbusProxyReadyTimeout):
+		return false
+	}
+}
+
+// Converts a flatpak-style policy string (semicolon-separated talk=/own=/call=/broadcast=/see=/filter
+// rules) into xdg-dbus-proxy command line arguments.
+func parseDbusProxyPolicy(policy string) []string {
+	var args []string
+
+	for _, rule := range strings.Split(policy, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if rule == "filter" {
+			args = append(args, "--filter")
+			continue
+		}
+
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "talk", "own", "call", "broadcast", "see":
+			args = append(args, "--"+kv[0]+"="+kv[1])
+		}
+	}
+
+	return args
+}
+
+// Kills a process started by this package, ignoring the case where it was never started or has
+// already exited.
+func killIfRunning(cmd *exec.Cmd) {
+	if cmd != nil && cmd.Process != nil && (cmd.ProcessState == nil || !cmd.ProcessState.Exited()) {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+	}
+}
+
+// strPid formats a process pid for logging, returning an empty string when no process was started.
+func strPid(cmd *exec.Cmd) string {
+	if cmd == nil || cmd.Process == nil {
+		return ""
+	}
+	return strconv.Itoa(cmd.Process.Pid)
+}
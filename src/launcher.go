@@ -0,0 +1,212 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	launcherDirect     = "direct"
+	launcherSudo       = "sudo"
+	launcherMachinectl = "machinectl"
+
+	machinedScopeRetry = 50
+	machinedScopeDelay = 100 * time.Millisecond
+)
+
+// launcher abstracts the mechanism used to transition from emptty's own process into the command
+// that runs as the target user.
+type launcher interface {
+	// command builds the *exec.Cmd that runs argv as usr. Its Env is filled in by the caller
+	// afterwards, same as the rest of commonSession.start().
+	command(usr *sysuser, argv ...string) *exec.Cmd
+
+	// resolvePid returns the pid that should be recorded in utmp for the running session. Most
+	// launchers simply report the pid of the *exec.Cmd they started; launchers that hand the
+	// process off to another supervisor resolve the real leaf pid instead.
+	resolvePid(cmd *exec.Cmd) int
+}
+
+// getLauncher resolves the launcher backend selected via the LAUNCHER= config key, defaulting to
+// the direct fork behaviour emptty has always used.
+func getLauncher(conf *config) launcher {
+	switch strings.ToLower(conf.Launcher) {
+	case launcherSudo:
+		return &sudoLauncher{}
+	case launcherMachinectl:
+		return &machinectlLauncher{}
+	default:
+		return &directLauncher{}
+	}
+}
+
+// directLauncher execs the target command directly, dropping privileges to usr exactly as emptty
+// has always done.
+type directLauncher struct{}
+
+func (l *directLauncher) command(usr *sysuser, argv ...string) *exec.Cmd {
+	return cmdAsUser(usr, argv[0], argv[1:]...)
+}
+
+func (l *directLauncher) resolvePid(cmd *exec.Cmd) int {
+	if cmd.Process == nil {
+		return 0
+	}
+	return cmd.Process.Pid
+}
+
+// sudoLauncher shells out via `sudo -u <user>`, useful on systems where a privileged daemon is
+// not allowed to setuid directly.
+type sudoLauncher struct{}
+
+func (l *sudoLauncher) command(usr *sysuser, argv ...string) *exec.Cmd {
+	return exec.Command("sudo", append([]string{"-u", usr.username, "--"}, argv...)...)
+}
+
+func (l *sudoLauncher) resolvePid(cmd *exec.Cmd) int {
+	if cmd.Process == nil {
+		return 0
+	}
+	return cmd.Process.Pid
+}
+
+// machinectlLauncher runs the session inside a transient systemd-machined scope via
+// `machinectl shell`, giving it proper per-user slice accounting and cgroup cleanup. Since
+// machinectl scrubs the environment, the prepared environment is written to a file under the
+// target user's XDG_RUNTIME_DIR and sourced by the shell invocation instead of being passed
+// directly.
+type machinectlLauncher struct {
+	uid int
+}
+
+func (l *machinectlLauncher) command(usr *sysuser, argv ...string) *exec.Cmd {
+	l.uid = usr.uid
+
+	strExec := strings.Join(argv, " ")
+
+	if envFile, err := writeLauncherEnvFile(usr); err != nil {
+		logPrint(err)
+	} else {
+		strExec = ". " + envFile + " && " + strExec
+	}
+
+	return exec.Command("machinectl", "shell", "--uid="+usr.strUid(), ".host", "/bin/sh", "-c", strExec)
+}
+
+func (l *machinectlLauncher) resolvePid(cmd *exec.Cmd) int {
+	if cmd.Process == nil {
+		return 0
+	}
+
+	// machinectl itself is a short-lived client that exits once the transient scope is started,
+	// so the pid to record in utmp is the leaf process inside that scope, not cmd.Process.Pid.
+	// systemd needs a moment to actually create that scope, so retry for a bit before giving up.
+	pid, err := waitMachinedScopePid(l.uid)
+	if err != nil {
+		logPrint(err)
+		return cmd.Process.Pid
+	}
+	return pid
+}
+
+// waitMachinedScopePid retries resolveMachinedScopePid for up to machinedScopeRetry attempts,
+// since the transient scope is created asynchronously by systemd and is rarely present the
+// instant `machinectl shell` returns.
+func waitMachinedScopePid(uid int) (int, error) {
+	var lastErr error
+
+	for i := 0; i < machinedScopeRetry; i++ {
+		pid, err := resolveMachinedScopePid(uid)
+		if err == nil {
+			return pid, nil
+		}
+		lastErr = err
+		time.Sleep(machinedScopeDelay)
+	}
+
+	return 0, lastErr
+}
+
+// writeLauncherEnvFile persists usr's prepared environment as a shell-sourceable file under its
+// XDG_RUNTIME_DIR, since machinectl drops everything but a minimal environment when transitioning
+// into the .host machine.
+func writeLauncherEnvFile(usr *sysuser) (string, error) {
+	path := usr.getenv(envXdgRuntimeDir) + "/emptty-launcher.env"
+
+	var b strings.Builder
+	for _, kv := range usr.environ() {
+		key, value := kv, ""
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			key, value = kv[:i], kv[i+1:]
+		}
+		b.WriteString("export " + shellQuote(key) + "=" + shellQuote(value) + "\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return "", err
+	}
+	os.Chown(path, usr.uid, usr.gid)
+
+	return path, nil
+}
+
+// shellQuote wraps s in single quotes, escaping any embedded single quote by closing the quotes,
+// adding a backslash-escaped quote and reopening them, so the result can be safely `.` sourced by
+// a POSIX shell without letting its content break out of the quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// resolveMachinedScopePid finds the transient scope systemd-machined created for uid's session
+// under its user slice and returns the most recently added pid in its cgroup.procs, which is the
+// leaf process of the `machinectl shell` invocation (the actual session shell), not the
+// short-lived machinectl client itself.
+func resolveMachinedScopePid(uid int) (int, error) {
+	scopes, err := filepath.Glob(fmt.Sprintf("/sys/fs/cgroup/user.slice/user-%d.slice/*.scope", uid))
+	if err != nil || len(scopes) == 0 {
+		return 0, fmt.Errorf("could not find a machined scope for uid %d", uid)
+	}
+
+	scopeDir := newestScope(scopes)
+
+	b, err := os.ReadFile(filepath.Join(scopeDir, "cgroup.procs"))
+	if err != nil {
+		return 0, err
+	}
+
+	pids := strings.Fields(string(b))
+	if len(pids) == 0 {
+		return 0, fmt.Errorf("machined scope %s has no processes", scopeDir)
+	}
+
+	return strconv.Atoi(pids[len(pids)-1])
+}
+
+// newestScope returns the most recently created of the given scope cgroup directories, in case
+// more than one is found under the user's slice.
+func newestScope(scopes []string) string {
+	newest := scopes[0]
+	newestModTime := scopeModTime(newest)
+
+	for _, scope := range scopes[1:] {
+		if t := scopeModTime(scope); t.After(newestModTime) {
+			newest = scope
+			newestModTime = t
+		}
+	}
+
+	return newest
+}
+
+func scopeModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,102 @@
+package src
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	pathProcNetRoute     = "/proc/net/route"
+	pathProcNetRouteIpv6 = "/proc/net/ipv6_route"
+)
+
+// Returns the IPv4 (char == '4') or IPv6 (char == '6') address of iface. When iface is empty, the
+// first non-loopback, UP interface that owns a default route is used instead, mirroring getty's
+// behaviour for the plain \4 and \6 issue escape sequences.
+func getIpAddress(iface string, char byte) string {
+	if iface == "" {
+		iface = defaultRouteInterface(char == '6')
+	}
+	if iface == "" {
+		return ""
+	}
+
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return ""
+	}
+
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return ""
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		if isIpv4 := ipNet.IP.To4() != nil; isIpv4 == (char == '4') {
+			return ipNet.IP.String()
+		}
+	}
+
+	return ""
+}
+
+// Returns the name of the first UP, non-loopback interface that owns a default route, read from
+// /proc/net/route or /proc/net/ipv6_route.
+func defaultRouteInterface(ipv6 bool) string {
+	path := pathProcNetRoute
+	if ipv6 {
+		path = pathProcNetRouteIpv6
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !ipv6 {
+		scanner.Scan() // header line, ipv6_route has none
+	}
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		var iface string
+		var isDefault bool
+
+		if ipv6 {
+			// destination destprefix source srcprefix nexthop metric refcnt use flags iface
+			if len(fields) < 10 {
+				continue
+			}
+			isDefault = strings.Trim(fields[0], "0") == "" && fields[1] == "00"
+			iface = fields[len(fields)-1]
+		} else {
+			// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+			if len(fields) < 2 {
+				continue
+			}
+			iface = fields[0]
+			isDefault = fields[1] == "00000000"
+		}
+
+		if isDefault && iface != "lo" && interfaceIsUp(iface) {
+			return iface
+		}
+	}
+
+	return ""
+}
+
+func interfaceIsUp(name string) bool {
+	ifi, err := net.InterfaceByName(name)
+	return err == nil && ifi.Flags&net.FlagUp != 0
+}
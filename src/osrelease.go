@@ -0,0 +1,49 @@
+package src
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+const pathOsRelease = "/etc/os-release"
+
+// getOsReleaseValue returns the requested /etc/os-release field for the \S issue escape sequence.
+// A bare \S (empty key) returns PRETTY_NAME, matching getty's behaviour; \S{KEY} falls back to
+// whatever KEY is actually present in /etc/os-release for any key not covered by that default.
+func getOsReleaseValue(key string) string {
+	if key == "" {
+		key = "PRETTY_NAME"
+	}
+
+	return parseOsReleaseFile(pathOsRelease)[key]
+}
+
+// parseOsReleaseFile reads an os-release formatted file into a key/value map, stripping optional
+// surrounding quotes from values as the file format allows.
+func parseOsReleaseFile(path string) map[string]string {
+	values := make(map[string]string)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		values[kv[0]] = strings.Trim(kv[1], `"'`)
+	}
+
+	return values
+}
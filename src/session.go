@@ -3,7 +3,11 @@ package src
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
+
+	"github.com/kianmeng/emptty/src/acl"
 )
 
 const (
@@ -39,15 +43,17 @@ type session interface {
 // commonSession defines structure with data required for starting the session
 type commonSession struct {
 	session
-	usr  *sysuser
-	d    *desktop
-	conf *config
-	dbus *dbus
+	usr      *sysuser
+	d        *desktop
+	conf     *config
+	dbus     *dbus
+	launcher launcher
+	acl      *aclRevertStack
 }
 
 // Starts user's session
 func startSession(usr *sysuser, d *desktop, conf *config) {
-	s := &commonSession{nil, usr, d, conf, nil}
+	s := &commonSession{nil, usr, d, conf, nil, getLauncher(conf), newAclRevertStack(os.Getpid())}
 
 	switch d.env {
 	case Wayland:
@@ -69,12 +75,12 @@ func (s *commonSession) start() {
 		s.usr.setenv(envXdgSessionType, s.d.env.sessionType())
 	}
 
-	if s.conf.AlwaysDbusLaunch {
+	if s.conf.AlwaysDbusLaunch || s.conf.EnableDbusProxy {
 		s.dbus = &dbus{}
 	}
 
 	session, strExec := s.prepareGuiCommand()
-	go handleInterrupt(makeInterruptChannel(), session)
+	go handleInterrupt(makeInterruptChannel(), session, s.acl, s.session)
 
 	sessionErrLog, sessionErrLogErr := initSessionErrorLogger(s.conf)
 	if sessionErrLogErr == nil {
@@ -85,7 +91,10 @@ func (s *commonSession) start() {
 	}
 
 	if s.dbus != nil {
-		s.dbus.launch(s.usr)
+		if err := s.dbus.launch(s.usr, s.conf); err != nil {
+			s.finishCarrier()
+			handleErr(err)
+		}
 	}
 
 	logPrint("Starting " + strExec)
@@ -97,7 +106,7 @@ func (s *commonSession) start() {
 
 	pid := s.getCarrierPid()
 	if pid <= 0 {
-		pid = session.Process.Pid
+		pid = s.launcher.resolvePid(session)
 	}
 
 	utmpEntry := addUtmpEntry(s.usr.username, pid, s.conf.strTTY(), s.usr.getenv(envDisplay))
@@ -109,6 +118,8 @@ func (s *commonSession) start() {
 		s.dbus.interrupt()
 	}
 
+	s.acl.drain()
+
 	carrierErr := s.finishCarrier()
 
 	endUtmpEntry(utmpEntry)
@@ -158,22 +169,59 @@ func (s *commonSession) defineEnvironment() {
 
 	// create XDG folder
 	if !s.conf.NoXdgFallback {
-		if !fileExists(s.usr.getenv(envXdgRuntimeDir)) {
-			err := os.MkdirAll(s.usr.getenv(envXdgRuntimeDir), 0700)
+		runtimeDir := s.usr.getenv(envXdgRuntimeDir)
+
+		if !fileExists(runtimeDir) {
+			err := os.MkdirAll(runtimeDir, 0700)
 			handleErr(err)
 
 			// Set owner of XDG folder
-			os.Chown(s.usr.getenv(envXdgRuntimeDir), s.usr.uid, s.usr.gid)
+			os.Chown(runtimeDir, s.usr.uid, s.usr.gid)
 
 			logPrint("Created XDG folder")
 		} else {
 			logPrint("XDG folder already exists, no need to create")
 		}
+
+		s.shareRuntimeAccess()
 	}
 
 	os.Chdir(s.usr.getenv(envPwd))
 }
 
+// Shares access to sockets inherited from the user that started emptty (typically the greeter's
+// own Wayland compositor or PulseAudio server), via POSIX ACLs rather than chown so ownership of
+// shared state does not change hands. Every grant is pushed onto s.acl so it can be reverted once
+// the session ends, or by `emptty --reset` if emptty crashes before it gets the chance.
+func (s *commonSession) shareRuntimeAccess() {
+	if s.conf.InheritWaylandSocket && s.conf.WaylandDisplaySocket != "" {
+		s.grantSocketAccess(s.conf.WaylandDisplaySocket, acl.Perm{Read: true, Write: true, Execute: true})
+	}
+
+	if s.conf.InheritPulseSocket && s.conf.PulseSocket != "" {
+		s.grantSocketAccess(s.conf.PulseSocket, acl.Perm{Read: true, Write: true, Execute: true})
+	}
+}
+
+// grantSocketAccess grants perm for s.usr.uid on socketPath itself, plus --x traversal on the
+// directory that actually contains it (normally the login user's own XDG_RUNTIME_DIR, e.g.
+// /run/user/<login-uid>) when that directory is owned by another user -- without it the grant on
+// the socket alone is unreachable.
+func (s *commonSession) grantSocketAccess(socketPath string, perm acl.Perm) {
+	dir := filepath.Dir(socketPath)
+	if info, err := os.Stat(dir); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != s.usr.uid {
+			if err := s.acl.grant(dir, s.usr.uid, acl.Perm{Execute: true}); err != nil {
+				logPrint(err)
+			}
+		}
+	}
+
+	if err := s.acl.grant(socketPath, s.usr.uid, perm); err != nil {
+		logPrint(err)
+	}
+}
+
 // Prepares command for starting GUI.
 func (s *commonSession) prepareGuiCommand() (cmd *exec.Cmd, strExec string) {
 	strExec, allowStartupPrefix := s.d.getStrExec()
@@ -188,9 +236,9 @@ func (s *commonSession) prepareGuiCommand() (cmd *exec.Cmd, strExec string) {
 	}
 
 	if startScript {
-		cmd = cmdAsUser(s.usr, s.getLoginShell(), strings.Split(strExec, " ")...)
+		cmd = s.launcher.command(s.usr, append([]string{s.getLoginShell()}, strings.Split(strExec, " ")...)...)
 	} else {
-		cmd = cmdAsUser(s.usr, strExec)
+		cmd = s.launcher.command(s.usr, strExec)
 	}
 
 	return cmd, strExec
@@ -205,10 +253,18 @@ func (s *commonSession) getLoginShell() string {
 }
 
 // Catch interrupt signal chan and interrupts Cmd.
-func handleInterrupt(c chan os.Signal, cmd *exec.Cmd) {
+func handleInterrupt(c chan os.Signal, cmd *exec.Cmd, acl *aclRevertStack, sess session) {
 	<-c
 	interrupted = true
 	logPrint("Caught interrupt signal")
+
+	// Revoke any X host access control entries here too, so a killed session cannot leak them --
+	// finishCarrier() is only reached once session.Wait() returns, further down in start().
+	if xorg, ok := sess.(*xorgSession); ok {
+		xorg.revokeXhostUsers()
+	}
+
 	cmd.Process.Signal(os.Interrupt)
 	cmd.Wait()
+	acl.drain()
 }
@@ -0,0 +1,73 @@
+// Package xcb wraps just enough of libxcb to manage the X server's host-based access control
+// list, so emptty can grant local users access to a session's display without copying
+// $XAUTHORITY around.
+package xcb
+
+/*
+#cgo pkg-config: xcb
+#include <stdlib.h>
+#include <string.h>
+#include <xcb/xcb.h>
+#include <xcb/xproto.h>
+
+static xcb_void_cookie_t change_host(xcb_connection_t *c, uint8_t mode, const char *category, const char *value) {
+	size_t catLen = strlen(category);
+	size_t valLen = strlen(value);
+	size_t len = catLen + 1 + valLen;
+
+	uint8_t *address = malloc(len);
+	memcpy(address, category, catLen);
+	address[catLen] = 0;
+	memcpy(address + catLen + 1, value, valLen);
+
+	xcb_void_cookie_t cookie = xcb_change_hosts_checked(c, mode, XCB_FAMILY_SERVER_INTERPRETED, (uint16_t)len, address);
+	free(address);
+	return cookie;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+const categoryLocalUser = "localuser"
+
+// AddLocalUserHost inserts a FamilyServerInterpreted "si:localuser:<username>" entry into the X
+// server's host access list for display, the same entry `xhost +si:localuser:<username>` would
+// add, letting clients running as username connect without XAUTHORITY.
+func AddLocalUserHost(display, username string) error {
+	return changeHost(display, username, C.XCB_HOST_MODE_INSERT)
+}
+
+// RemoveLocalUserHost removes the entry previously added by AddLocalUserHost.
+func RemoveLocalUserHost(display, username string) error {
+	return changeHost(display, username, C.XCB_HOST_MODE_DELETE)
+}
+
+func changeHost(display, username string, mode C.uint32_t) error {
+	cDisplay := C.CString(display)
+	defer C.free(unsafe.Pointer(cDisplay))
+
+	var screen C.int
+	conn := C.xcb_connect(cDisplay, &screen)
+	defer C.xcb_disconnect(conn)
+
+	if C.xcb_connection_has_error(conn) != 0 {
+		return errors.New("xcb: failed to connect to " + display)
+	}
+
+	cCategory := C.CString(categoryLocalUser)
+	defer C.free(unsafe.Pointer(cCategory))
+	cUsername := C.CString(username)
+	defer C.free(unsafe.Pointer(cUsername))
+
+	cookie := C.change_host(conn, C.uint8_t(mode), cCategory, cUsername)
+	if cerr := C.xcb_request_check(conn, cookie); cerr != nil {
+		C.free(unsafe.Pointer(cerr))
+		return errors.New("xcb: failed to change host entry for " + username + " on " + display)
+	}
+
+	return nil
+}
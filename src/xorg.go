@@ -0,0 +1,119 @@
+package src
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kianmeng/emptty/src/xcb"
+)
+
+const (
+	binXorg        = "X"
+	xorgReadyRetry = 50
+	xorgReadyDelay = 100 * time.Millisecond
+)
+
+// xorgSession starts and manages the Xorg server process backing an Xorg desktop session.
+type xorgSession struct {
+	*commonSession
+	carrier *exec.Cmd
+}
+
+// Starts the Xorg server on the configured display and VT. Once it reports ready, grants the
+// session user and any XHOST_USERS= access to the display via the X host access control list.
+func (s *xorgSession) startCarrier() {
+	display := s.usr.getenv(envDisplay)
+	if display == "" {
+		display = ":0"
+		s.usr.setenv(envDisplay, display)
+	}
+
+	s.carrier = exec.Command(binXorg, display, "vt"+s.conf.strTTY())
+	if err := s.carrier.Start(); err != nil {
+		handleErr(err)
+	}
+
+	if !waitXorgReady(display) {
+		logPrint("Xorg did not become ready on " + display)
+		return
+	}
+
+	s.grantXhostUsers(display)
+}
+
+// Returns the pid of the running Xorg server.
+func (s *xorgSession) getCarrierPid() int {
+	if s.carrier == nil || s.carrier.Process == nil {
+		return 0
+	}
+	return s.carrier.Process.Pid
+}
+
+// Revokes any XHOST_USERS access granted by startCarrier, then terminates the Xorg server.
+func (s *xorgSession) finishCarrier() error {
+	s.revokeXhostUsers()
+
+	if s.carrier == nil || s.carrier.Process == nil {
+		return nil
+	}
+
+	s.carrier.Process.Signal(os.Interrupt)
+	return s.carrier.Wait()
+}
+
+// Inserts a si:localuser: entry for the session user and for every username listed in
+// XHOST_USERS, so local clients can connect to the session's display without copying XAUTHORITY.
+func (s *xorgSession) grantXhostUsers(display string) {
+	for _, username := range s.xhostUsernames() {
+		if err := xcb.AddLocalUserHost(display, username); err != nil {
+			logPrint(err)
+		}
+	}
+}
+
+// Removes the entries inserted by grantXhostUsers. Safe to call even if startCarrier never
+// reached the point of granting access, or if called more than once.
+func (s *xorgSession) revokeXhostUsers() {
+	display := s.usr.getenv(envDisplay)
+	if display == "" {
+		return
+	}
+
+	for _, username := range s.xhostUsernames() {
+		if err := xcb.RemoveLocalUserHost(display, username); err != nil {
+			logPrint(err)
+		}
+	}
+}
+
+// xhostUsernames returns the session user plus every username configured via XHOST_USERS.
+func (s *xorgSession) xhostUsernames() []string {
+	usernames := []string{s.usr.username}
+
+	if s.conf.XhostUsers != "" {
+		for _, username := range strings.Split(s.conf.XhostUsers, ",") {
+			if username = strings.TrimSpace(username); username != "" {
+				usernames = append(usernames, username)
+			}
+		}
+	}
+
+	return usernames
+}
+
+// waitXorgReady polls for the Xorg socket to appear, giving the server a chance to finish
+// initializing before anything tries to use the display.
+func waitXorgReady(display string) bool {
+	socket := "/tmp/.X11-unix/X" + strings.TrimPrefix(display, ":")
+
+	for i := 0; i < xorgReadyRetry; i++ {
+		if fileExists(socket) {
+			return true
+		}
+		time.Sleep(xorgReadyDelay)
+	}
+
+	return false
+}